@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// tokenClaims is the JWT payload the control API expects: the standard
+// registered claims plus a role ("reader" or "admin") used for coarse
+// authorization between template reads and config reloads.
+type tokenClaims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// tokenVerifier validates bearer tokens against a fixed public key,
+// issuer, and audience loaded once at startup.
+type tokenVerifier struct {
+	publicKey interface{}
+	issuer    string
+	audience  string
+}
+
+// newTokenVerifier loads the RSA or ECDSA public key PEM file at path and
+// returns a tokenVerifier configured to check the given issuer and
+// audience on every token.
+func newTokenVerifier(path, issuer, audience string) (*tokenVerifier, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading JWT public key")
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("failed decoding PEM block from JWT public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed parsing JWT public key")
+	}
+
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("JWT public key must be RSA or ECDSA")
+	}
+
+	return &tokenVerifier{publicKey: key, issuer: issuer, audience: audience}, nil
+}
+
+// verify parses and validates a bearer token, returning its claims on
+// success.
+func (v *tokenVerifier) verify(tokenString string) (*tokenClaims, error) {
+	parsed, err := jwt.ParseWithClaims(tokenString, &tokenClaims{}, func(t *jwt.Token) (interface{}, error) {
+		return v.publicKey, nil
+	}, jwt.WithIssuer(v.issuer), jwt.WithAudience(v.audience),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := parsed.Claims.(*tokenClaims)
+	if !ok || !parsed.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// requireRole wraps next so that it only runs for requests bearing a valid
+// JWT whose role claim is role or "admin" ("admin" satisfies any role
+// requirement). Requests that fail authentication or authorization get a
+// 401 and next is never called.
+func (v *tokenVerifier) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if tokenString == "" {
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := v.verify(tokenString)
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		if claims.Role != role && claims.Role != "admin" {
+			http.Error(w, "insufficient role", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// registerControlAPI wires the authenticated template and config-reload
+// endpoints onto mux. Every route it registers is protected by verifier;
+// /health is registered separately and left open.
+func registerControlAPI(mux *http.ServeMux, verifier *tokenVerifier, runtimes []*networkRuntime, configPath string) {
+	runtimeByName := make(map[string]*networkRuntime, len(runtimes))
+	var defaultNetwork string
+	for i, rt := range runtimes {
+		runtimeByName[rt.config.Name] = rt
+		if i == 0 {
+			defaultNetwork = rt.config.Name
+		}
+	}
+
+	mux.HandleFunc("/template/current", verifier.requireRole("reader", func(w http.ResponseWriter, r *http.Request) {
+		rt := selectRuntime(runtimeByName, defaultNetwork, r.URL.Query().Get("network"))
+		if rt == nil {
+			http.Error(w, "unknown network", http.StatusNotFound)
+			return
+		}
+
+		template := rt.getCurrentTemplate()
+		if template == nil {
+			http.Error(w, "no template fetched yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(template)
+	}))
+
+	mux.HandleFunc("/template/stream", verifier.requireRole("reader", func(w http.ResponseWriter, r *http.Request) {
+		rt := selectRuntime(runtimeByName, defaultNetwork, r.URL.Query().Get("network"))
+		if rt == nil {
+			http.Error(w, "unknown network", http.StatusNotFound)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ch := rt.subscribe()
+		defer rt.unsubscribe(ch)
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case templateJSON := <-ch:
+				fmt.Fprintf(w, "data: %s\n\n", templateJSON)
+				flusher.Flush()
+			}
+		}
+	}))
+
+	mux.HandleFunc("/config/reload", verifier.requireRole("admin", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		applied, err := reloadConfig(configPath, runtimeByName)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to reload config: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":           "reloaded",
+			"networks_updated": applied,
+		})
+	}))
+}
+
+// selectRuntime resolves a network name from a query parameter to its
+// runtime, falling back to defaultNetwork when requested is empty.
+func selectRuntime(byName map[string]*networkRuntime, defaultNetwork, requested string) *networkRuntime {
+	name := requested
+	if name == "" {
+		name = defaultNetwork
+	}
+	return byName[name]
+}
+
+// reloadConfig re-reads configPath and atomically swaps each known
+// network's MinerInfo, CanxiumAddr, and block-wait interval, without
+// restarting any fetch-loop goroutines. It returns the number of networks
+// whose settings were applied.
+func reloadConfig(configPath string, runtimeByName map[string]*networkRuntime) (int, error) {
+	file, err := os.Open(configPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var reloaded BridgeConfig
+	if err := json.NewDecoder(file).Decode(&reloaded); err != nil {
+		return 0, err
+	}
+
+	networks, err := resolveNetworks(reloaded.Network, reloaded)
+	if err != nil {
+		return 0, err
+	}
+
+	blockWaitMSec, err := strconv.Atoi(reloaded.BlockWaitTimeMSec)
+	if err != nil {
+		return 0, err
+	}
+	blockWaitTime := time.Duration(blockWaitMSec) * time.Millisecond
+
+	applied := 0
+	for _, net := range networks {
+		rt, ok := runtimeByName[net.Name]
+		if !ok {
+			continue
+		}
+
+		rt.setReloadableConfig(reloadableConfig{
+			MinerInfo:     net.MinerInfo,
+			CanxiumAddr:   net.CanxiumAddr,
+			BlockWaitTime: blockWaitTime,
+		})
+		applied++
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kaspanet/kaspad/app/appmessage"
+	"github.com/kaspanet/kaspad/infrastructure/network/rpcclient"
+	"github.com/pkg/errors"
+)
+
+// kaspaEndpoint tracks a single kaspad RPC connection and the health state
+// KaspaAPI uses to decide whether it is safe to route requests to it.
+type kaspaEndpoint struct {
+	address string
+
+	mu        sync.Mutex
+	client    *rpcclient.RPCClient
+	connected bool
+	lastDAA   uint64
+}
+
+func (e *kaspaEndpoint) setConnected(connected bool) {
+	e.mu.Lock()
+	changed := e.connected != connected
+	e.connected = connected
+	e.mu.Unlock()
+
+	if changed {
+		log.Printf("kaspa endpoint %s connected=%v", e.address, connected)
+	}
+}
+
+func (e *kaspaEndpoint) isConnected() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.connected
+}
+
+func (e *kaspaEndpoint) setLastDAA(daa uint64) {
+	e.mu.Lock()
+	e.lastDAA = daa
+	e.mu.Unlock()
+}
+
+func (e *kaspaEndpoint) getLastDAA() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastDAA
+}
+
+func (e *kaspaEndpoint) getClient() *rpcclient.RPCClient {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.client
+}
+
+// KaspaAPI provides access to a pool of Kaspa RPC clients and manages block
+// template requests, transparently failing over between endpoints when the
+// current primary errors out or falls behind the best-seen tip.
+//
+// Rather than being polled on a fixed interval, KaspaAPI registers for
+// kaspad's NotifyNewBlockTemplate push notifications on every endpoint and
+// signals notifyCh whenever any of them fires. WaitForNewTemplate lets a
+// caller block until that happens, or until blockWaitTime elapses, so a new
+// tip is picked up immediately while blockWaitTime still bounds staleness if
+// notifications are ever missed.
+type KaspaAPI struct {
+	blockWaitTime time.Duration
+	daaLagLimit   uint64
+
+	mu        sync.Mutex
+	endpoints []*kaspaEndpoint
+	primary   int
+
+	notifyCh chan struct{}
+}
+
+// NewKaspaAPI creates and returns a new KaspaAPI instance backed by a pool
+// of RPC clients, one per address in addresses. daaLagLimit bounds how far
+// an endpoint's reported DAA score may trail the best-seen tip before it is
+// considered behind and failed away from; pass 0 to disable the check.
+//
+// Endpoints are connected independently: one address failing to dial does
+// not prevent the others from being used. A failed endpoint is recorded as
+// disconnected and handed to runReconnectLoop to bring back later, the same
+// as an endpoint that goes down after a successful start. NewKaspaAPI only
+// returns an error when every endpoint fails to connect.
+func NewKaspaAPI(addresses []string, blockWaitTime time.Duration, daaLagLimit uint64) (*KaspaAPI, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no kaspa RPC endpoints configured")
+	}
+
+	endpoints := make([]*kaspaEndpoint, 0, len(addresses))
+	connectedCount := 0
+	for _, address := range addresses {
+		client, err := rpcclient.NewRPCClient(address)
+		if err != nil {
+			log.Printf("kaspa endpoint %s: failed to connect, starting degraded: %v", address, err)
+			endpoints = append(endpoints, &kaspaEndpoint{
+				address:   address,
+				connected: false,
+			})
+			continue
+		}
+		endpoints = append(endpoints, &kaspaEndpoint{
+			address:   address,
+			client:    client,
+			connected: true,
+		})
+		connectedCount++
+	}
+
+	if connectedCount == 0 {
+		return nil, errors.New("failed connecting to any kaspa RPC endpoint")
+	}
+
+	ks := &KaspaAPI{
+		blockWaitTime: blockWaitTime,
+		daaLagLimit:   daaLagLimit,
+		endpoints:     endpoints,
+		notifyCh:      make(chan struct{}, 1),
+	}
+
+	for _, ep := range endpoints {
+		if ep.isConnected() {
+			if err := ks.registerNotifications(ep); err != nil {
+				log.Printf("kaspa endpoint %s: failed to register for new block template notifications: %v", ep.address, err)
+			}
+		}
+		go ks.runReconnectLoop(ep)
+		if ks.daaLagLimit > 0 {
+			go ks.runDAAProbeLoop(ep)
+		}
+	}
+
+	return ks, nil
+}
+
+// runDAAProbeLoop periodically refreshes ep's lastDAA independent of
+// whether ep is the current primary. GetBlockTemplate only ever queries
+// endpoints in primary-first order and returns as soon as one succeeds, so
+// without this a secondary endpoint's lastDAA would stay stuck at
+// whatever it was the last time it was primary (or 0, if it never was),
+// and bestSeenDAAScore would just echo the primary's own result — making
+// the lag check it feeds never trip. Only runs when daaLagLimit is
+// actually in use.
+func (ks *KaspaAPI) runDAAProbeLoop(ep *kaspaEndpoint) {
+	ticker := time.NewTicker(ks.blockWaitTime)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !ep.isConnected() {
+			continue
+		}
+
+		info, err := ep.getClient().GetBlockDAGInfo()
+		if err != nil {
+			log.Printf("kaspa endpoint %s: error probing DAA score: %v", ep.address, err)
+			continue
+		}
+		ep.setLastDAA(info.VirtualDAAScore)
+	}
+}
+
+// registerNotifications subscribes to ep's NotifyNewBlockTemplate
+// notifications, signaling ks.notifyCh every time one arrives so that
+// WaitForNewTemplate wakes up immediately instead of waiting out the
+// blockWaitTime watchdog.
+func (ks *KaspaAPI) registerNotifications(ep *kaspaEndpoint) error {
+	return ep.getClient().RegisterForNewBlockTemplateNotifications(func(_ *appmessage.NewBlockTemplateNotificationMessage) {
+		ks.signalNewTemplate()
+	})
+}
+
+// signalNewTemplate wakes up any goroutine blocked in WaitForNewTemplate
+// without blocking itself: notifyCh only ever needs to hold one pending
+// signal.
+func (ks *KaspaAPI) signalNewTemplate() {
+	select {
+	case ks.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// WaitForNewTemplate blocks until a NotifyNewBlockTemplate notification has
+// arrived from some endpoint, or maxWait elapses, whichever comes first. It
+// returns true if woken by a notification and false on timeout, letting the
+// caller treat maxWait as a staleness watchdog rather than the primary
+// fetch cadence.
+func (ks *KaspaAPI) WaitForNewTemplate(maxWait time.Duration) bool {
+	select {
+	case <-ks.notifyCh:
+		return true
+	case <-time.After(maxWait):
+		return false
+	}
+}
+
+// runReconnectLoop watches a single endpoint and, once it has been marked
+// unhealthy, retries connecting to it with exponential backoff until it
+// recovers.
+func (ks *KaspaAPI) runReconnectLoop(ep *kaspaEndpoint) {
+	const (
+		initialBackoff = time.Second
+		maxBackoff     = time.Minute
+	)
+	backoff := initialBackoff
+
+	for {
+		time.Sleep(backoff)
+
+		if ep.isConnected() {
+			backoff = initialBackoff
+			continue
+		}
+
+		client, err := rpcclient.NewRPCClient(ep.address)
+		if err != nil {
+			log.Printf("kaspa endpoint %s still unreachable: %v", ep.address, err)
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+
+		ep.mu.Lock()
+		ep.client = client
+		ep.mu.Unlock()
+
+		if err := ks.registerNotifications(ep); err != nil {
+			log.Printf("kaspa endpoint %s: failed to re-register for new block template notifications: %v", ep.address, err)
+		}
+
+		ep.setConnected(true)
+		backoff = initialBackoff
+	}
+}
+
+// bestSeenDAAScore returns the highest DAA score last observed across all
+// endpoints, used to detect when the current primary has fallen behind.
+func (ks *KaspaAPI) bestSeenDAAScore() uint64 {
+	var best uint64
+	for _, ep := range ks.endpoints {
+		if daa := ep.getLastDAA(); daa > best {
+			best = daa
+		}
+	}
+	return best
+}
+
+// daaIsLagging reports whether daa trails best by more than lagLimit,
+// the rule GetBlockTemplate uses to decide an endpoint has fallen behind
+// the best-seen tip and should be failed away from. A lagLimit of 0
+// disables the check.
+func daaIsLagging(daa, best, lagLimit uint64) bool {
+	return lagLimit > 0 && best > lagLimit && daa+lagLimit < best
+}
+
+// GetBlockTemplate fetches a new block template from the currently-healthy
+// primary endpoint. On error, or when the response's DAA score trails the
+// best-seen tip by more than daaLagLimit, the endpoint is marked unhealthy
+// and the request is retried against the next healthy endpoint.
+func (ks *KaspaAPI) GetBlockTemplate(miningAddr string, canxiumAddr string, minerInfo string) (*appmessage.GetBlockTemplateResponseMessage, error) {
+	ks.mu.Lock()
+	order := make([]int, 0, len(ks.endpoints))
+	order = append(order, ks.primary)
+	for i := range ks.endpoints {
+		if i != ks.primary {
+			order = append(order, i)
+		}
+	}
+	ks.mu.Unlock()
+
+	var lastErr error
+	for _, i := range order {
+		ep := ks.endpoints[i]
+		if !ep.isConnected() {
+			continue
+		}
+
+		template, err := ep.getClient().GetBlockTemplate(miningAddr, fmt.Sprintf(`Katpool/%s`, canxiumAddr))
+		if err != nil {
+			lastErr = errors.Wrapf(err, "endpoint %s", ep.address)
+			ep.setConnected(false)
+			continue
+		}
+
+		daa := template.Block.Header.DAAScore
+		ep.setLastDAA(daa)
+
+		if best := ks.bestSeenDAAScore(); daaIsLagging(daa, best, ks.daaLagLimit) {
+			log.Printf("kaspa endpoint %s is %d DAA behind best-seen tip %d, marking unhealthy", ep.address, best-daa, best)
+			ep.setConnected(false)
+			lastErr = errors.Errorf("endpoint %s fell behind best-seen DAA tip (%d < %d)", ep.address, daa, best)
+			continue
+		}
+
+		ks.mu.Lock()
+		ks.primary = i
+		ks.mu.Unlock()
+
+		return template, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no healthy kaspa RPC endpoints available")
+	}
+	return nil, errors.Wrap(lastErr, "failed fetching new block template from kaspa")
+}
+
+// Status returns each endpoint's health for reporting through /health:
+// "ok" for the current primary, "standby" for other healthy endpoints, and
+// "fail" for endpoints currently being reconnected.
+func (ks *KaspaAPI) Status() map[string]string {
+	ks.mu.Lock()
+	primary := ks.primary
+	ks.mu.Unlock()
+
+	status := make(map[string]string, len(ks.endpoints))
+	for i, ep := range ks.endpoints {
+		switch {
+		case !ep.isConnected():
+			status[ep.address] = "fail"
+		case i == primary:
+			status[ep.address] = "ok"
+		default:
+			status[ep.address] = "standby"
+		}
+	}
+	return status
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestDAAIsLagging(t *testing.T) {
+	cases := []struct {
+		name     string
+		daa      uint64
+		best     uint64
+		lagLimit uint64
+		want     bool
+	}{
+		{"disabled check", 0, 1000, 0, false},
+		{"at tip", 1000, 1000, 10, false},
+		{"within limit", 995, 1000, 10, false},
+		{"exactly at limit", 990, 1000, 10, false},
+		{"one past limit", 989, 1000, 10, true},
+		{"far behind", 100, 1000, 10, true},
+		{"best below limit itself", 0, 5, 10, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := daaIsLagging(c.daa, c.best, c.lagLimit); got != c.want {
+				t.Errorf("daaIsLagging(%d, %d, %d) = %v, want %v", c.daa, c.best, c.lagLimit, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBestSeenDAAScore(t *testing.T) {
+	ks := &KaspaAPI{endpoints: []*kaspaEndpoint{{address: "a"}, {address: "b"}, {address: "c"}}}
+	ks.endpoints[0].setLastDAA(100)
+	ks.endpoints[1].setLastDAA(250)
+	ks.endpoints[2].setLastDAA(180)
+
+	if got := ks.bestSeenDAAScore(); got != 250 {
+		t.Errorf("bestSeenDAAScore() = %d, want 250", got)
+	}
+}
+
+func TestBestSeenDAAScoreNoEndpoints(t *testing.T) {
+	ks := &KaspaAPI{}
+	if got := ks.bestSeenDAAScore(); got != 0 {
+		t.Errorf("bestSeenDAAScore() on empty pool = %d, want 0", got)
+	}
+}
@@ -8,54 +8,56 @@ import (
 	"net/http"
 	"os"
 	"strconv"
-	"sync"
 	"time"
 	"strings"
 
 	"github.com/go-redis/redis/v8"
 	// "github.com/joho/godotenv"
-	"github.com/kaspanet/kaspad/app/appmessage"
 	"github.com/kaspanet/kaspad/cmd/kaspawallet/libkaspawallet"
-	"github.com/kaspanet/kaspad/infrastructure/network/rpcclient"
 	"github.com/kaspanet/kaspad/util"
-	"github.com/pkg/errors"
 	"golang.org/x/net/context"
 )
 
-// KaspaAPI provides access to the Kaspa RPC client and manages block template requests.
-type KaspaAPI struct {
-	address       string
-	blockWaitTime time.Duration
-	kaspad        *rpcclient.RPCClient
-	connected     bool
-}
-
 // BridgeConfig represents the configuration settings used to connect to Kaspa and Redis.
+//
+// Network holds either a single legacy network name (a JSON string) or a
+// list of NetworkConfig entries for multi-network fan-out; see
+// resolveNetworks. The remaining top-level RPCServer/CanxiumAddr/
+// MinerInfo/Redis*/DAALagThreshold fields are only consulted when
+// migrating a legacy single-network config into the list form.
 type BridgeConfig struct {
-	RPCServer         []string `json:"node"`
-	Network           string   `json:"network"`
-	BlockWaitTimeMSec string   `json:"block_wait_time_milliseconds"`
+	RPCServer         []string        `json:"node"`
+	Network           json.RawMessage `json:"network"`
+	BlockWaitTimeMSec string          `json:"block_wait_time_milliseconds"`
 	RedisAddress      string   `json:"redis_address"`
 	RedisChannel      string   `json:"redis_channel"`
 	MinerInfo         string   `json:"miner_info"`
 	CanxiumAddr		 string	  `json:"canxiumAddr"`
-}
-
-// NewKaspaAPI creates and returns a new KaspaAPI instance with a configured RPC client.
-func NewKaspaAPI(address string, blockWaitTime time.Duration) (*KaspaAPI, error) {
-	client, err := rpcclient.NewRPCClient(address)
-	if err != nil {
-		return nil, err
-	}
 
-	return &KaspaAPI{
-		address:       address,
-		blockWaitTime: blockWaitTime,
-		kaspad:        client,
-		connected:     true,
-	}, nil
+	// RedisMode selects the Redis transport: "pubsub" (default) keeps the
+	// original Publish behavior, "stream" switches to XADD/consumer groups
+	// for at-least-once delivery across worker restarts.
+	RedisMode          string `json:"redis_mode"`
+	RedisStreamMaxLen  int64  `json:"redis_stream_maxlen"`
+	RedisConsumerGroup string `json:"redis_consumer_group"`
+	RedisConsumerName  string `json:"redis_consumer_name"`
+	RedisClaimIdleMSec string `json:"redis_claim_idle_milliseconds"`
+
+	// DAALagThreshold bounds how far a kaspa RPC endpoint's reported DAA
+	// score may trail the best-seen tip before KaspaAPI treats it as
+	// behind and fails over to another endpoint. 0 disables the check.
+	DAALagThreshold uint64 `json:"daa_lag_threshold"`
+
+	// JWT settings for the authenticated control API (everything on :8080
+	// except /health). JWTPublicKeyPath points at a PEM-encoded RSA or
+	// ECDSA public key used to verify bearer tokens.
+	JWTPublicKeyPath string `json:"jwt_public_key_path"`
+	JWTIssuer        string `json:"jwt_issuer"`
+	JWTAudience      string `json:"jwt_audience"`
 }
 
+const configPath = "./config/config.json"
+
 func fetchKaspaAccountFromPrivateKey(network, privateKeyHex string) (string, error) {
 	prefix := util.Bech32PrefixKaspa
 	if network == "testnet-10" {
@@ -104,17 +106,6 @@ func ProcessCanxiumAddress(address string) string {
 	return address
 }
 
-// GetBlockTemplate fetches a new block template from the Kaspa daemon using the RPC client.
-func (ks *KaspaAPI) GetBlockTemplate(miningAddr string, canxiumAddr string, minerInfo string) (*appmessage.GetBlockTemplateResponseMessage, error) {
-	template, err := ks.kaspad.GetBlockTemplate(miningAddr,
-		fmt.Sprintf(`Katpool/%s`, canxiumAddr))		
-
-	if err != nil {
-		return nil, errors.Wrap(err, "failed fetching new block template from kaspa")
-	}
-	return template, nil
-}
-
 func main() {
 	// Step 1: Load .env file
 	// err := godotenv.Load(".env")
@@ -131,10 +122,8 @@ func main() {
 
 	fmt.Println("CANXIUM_ADDR:", canxiumAddr)
 
-	privateKey := os.Getenv("TREASURY_PRIVATE_KEY")
-
 	// Open the JSON file
-	file, err := os.Open("./config/config.json")
+	file, err := os.Open(configPath)
 	if err != nil {
 		fmt.Printf("Error opening file: %v\n", err)
 		return
@@ -155,11 +144,10 @@ func main() {
 	}
 	log.Printf("Config : %v\n", config)
 
-	address, err := fetchKaspaAccountFromPrivateKey(config.Network, privateKey)
+	networks, err := resolveNetworks(config.Network, config)
 	if err != nil {
-		log.Fatalf("failed to retrieve address from private key : %v", err)
+		log.Fatalf("failed to resolve network config: %v", err)
 	}
-	log.Printf("Address : %v\n", address)
 
 	// Initialize Redis client
 	ctx := context.Background()
@@ -185,55 +173,30 @@ func main() {
 		return
 	}
 
-	var rpcURL string
-	switch config.Network {
-	case "testnet-10":
-		rpcURL = "kaspad-test10:16210"
-	default:
-		rpcURL = "kaspad:16110"
-	}
+	// Initialize one Kaspa API pool per network entry, all sharing the
+	// same Redis client, and start an independent fetch-and-publish
+	// goroutine for each.
+	var runtimes []*networkRuntime
+	for _, net := range networks {
+		rt, err := newNetworkRuntime(ctx, rdb, net, time.Duration(num)*time.Millisecond)
+		if err != nil {
+			log.Fatalf("failed to initialize network %s: %v", net.Name, err)
+		}
+		runtimes = append(runtimes, rt)
 
-	ksAPI, err := NewKaspaAPI(rpcURL, time.Duration(num)*time.Millisecond)
-	if err != nil {
-		log.Fatalf("failed to initialize Kaspa API: %v", err)
+		go runFetchLoop(ctx, rdb, rt)
 	}
 
-	var templateMutex sync.Mutex
-	var currentTemplate *appmessage.GetBlockTemplateResponseMessage
-
-	// Start a goroutine to continuously fetch block templates and publish them to Redis
-	go func() {
-		for {
-			template, err := ksAPI.GetBlockTemplate(address, ProcessCanxiumAddress(config.CanxiumAddr), ProcessCanxiumAddress(config.CanxiumAddr), config.MinerInfo)
-			if err != nil {
-				log.Printf("error fetching block template: %v", err)
-				time.Sleep(ksAPI.blockWaitTime)
-				continue
-			}
-
-			// Safely store the template
-			templateMutex.Lock()
-			currentTemplate = template
-			templateMutex.Unlock()
-
-			// Serialize the template to JSON
-			templateJSON, err := json.Marshal(template)
-			if err != nil {
-				log.Printf("error serializing template to JSON: %v", err)
-				continue
-			}
-
-			// Publish the JSON to Redis
-			err = rdb.Publish(ctx, config.RedisChannel, templateJSON).Err()
-			if err != nil {
-				log.Printf("error publishing to Redis: %v", err)
-			} else {
-				log.Printf("template published to Redis channel %s", config.RedisChannel)
-			}
-
-			time.Sleep(ksAPI.blockWaitTime)
+	// The control API is opt-in: existing deployments that predate it won't
+	// have jwt_public_key_path set, and must keep starting up and serving
+	// /health and the fetch/publish pipeline exactly as before.
+	var verifier *tokenVerifier
+	if config.JWTPublicKeyPath != "" {
+		verifier, err = newTokenVerifier(config.JWTPublicKeyPath, config.JWTIssuer, config.JWTAudience)
+		if err != nil {
+			log.Fatalf("failed to initialize JWT verifier: %v", err)
 		}
-	}()
+	}
 
 	go func() {
 		type HealthResponse struct {
@@ -241,7 +204,9 @@ func main() {
 			Services map[string]string `json:"services"`
 		}
 
-		http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		mux := http.NewServeMux()
+
+		mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 			services := map[string]string{}
 			status := "ok"
 
@@ -262,7 +227,9 @@ func main() {
 				}
 			}()
 
-			// Kaspa RPC check
+			// Kaspa RPC check: report each network's endpoints individually
+			// under "kaspa_rpc.<network>.<endpoint>", plus a per-network and
+			// an overall summary that only fail if every endpoint is down.
 			func() {
 				defer func() {
 					if r := recover(); r != nil {
@@ -271,7 +238,29 @@ func main() {
 					}
 				}()
 
-				if _, err := ksAPI.GetBlockTemplate(address, config.MinerInfo); err != nil {
+				overallDown := true
+				for _, rt := range runtimes {
+					networkDown := true
+					for addr, epStatus := range rt.ksAPI.Status() {
+						services["kaspa_rpc."+rt.config.Name+"."+addr] = epStatus
+						if epStatus != "fail" {
+							networkDown = false
+						}
+					}
+
+					if networkDown {
+						services["kaspa_rpc."+rt.config.Name] = "fail"
+					} else {
+						services["kaspa_rpc."+rt.config.Name] = "ok"
+						overallDown = false
+					}
+
+					if rt.config.RedisMode == "stream" {
+						services["redis_stream_pending."+rt.config.Name] = strconv.FormatInt(rt.streamState.get(), 10)
+					}
+				}
+
+				if overallDown {
 					services["kaspa_rpc"] = "fail"
 					status = "fail"
 				} else {
@@ -294,21 +283,27 @@ func main() {
 			_ = json.NewEncoder(w).Encode(resp)
 		})
 
-		log.Println("Health check endpoint started on :8080")
-		if err := http.ListenAndServe(":8080", nil); err != nil {
-			log.Fatalf("Failed to start health server: %v", err)
+		if verifier != nil {
+			registerControlAPI(mux, verifier, runtimes, configPath)
+		} else {
+			log.Println("jwt_public_key_path not set: control API (/template/*, /config/reload) disabled")
+		}
+		registerMetricsHandler(mux, runtimes)
+
+		log.Println("Health and control API listening on :8080")
+		if err := http.ListenAndServe(":8080", mux); err != nil {
+			log.Fatalf("Failed to start HTTP server: %v", err)
 		}
 	}()
 
-	// Output block template in the main function
+	// Output block template status in the main function
 	for {
 		time.Sleep(5 * time.Second) // Adjust the frequency of logging as needed
 
-		templateMutex.Lock()
-		if currentTemplate != nil {
-		} else {
-			fmt.Println("No block template fetched yet.")
+		for _, rt := range runtimes {
+			if !rt.hasTemplate() {
+				fmt.Printf("No block template fetched yet for network %s.\n", rt.config.Name)
+			}
 		}
-		templateMutex.Unlock()
 	}
 }
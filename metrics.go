@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// deltaSizeBucketBounds are the upper bounds (in bytes) of the Prometheus
+// histogram buckets used for katpool_template_delta_bytes.
+var deltaSizeBucketBounds = []float64{64, 256, 1024, 4096, 16384, 65536}
+
+// metrics tracks per-network fetch/publish/dedup counters and a delta-size
+// histogram, exposed through the /metrics Prometheus endpoint.
+type metrics struct {
+	mu sync.Mutex
+
+	fetched      uint64
+	published    uint64
+	deduplicated uint64
+	deltaBuckets map[float64]uint64
+	deltaSizeSum float64
+	deltaSizeObs uint64
+}
+
+// metricsSnapshot is an immutable, lock-free copy of a metrics instance's
+// current values, suitable for rendering.
+type metricsSnapshot struct {
+	Fetched      uint64
+	Published    uint64
+	Deduplicated uint64
+	DeltaBuckets map[float64]uint64
+	DeltaSizeSum float64
+	DeltaSizeObs uint64
+}
+
+func newMetrics() *metrics {
+	buckets := make(map[float64]uint64, len(deltaSizeBucketBounds))
+	for _, bound := range deltaSizeBucketBounds {
+		buckets[bound] = 0
+	}
+	return &metrics{deltaBuckets: buckets}
+}
+
+func (m *metrics) recordFetched() {
+	m.mu.Lock()
+	m.fetched++
+	m.mu.Unlock()
+}
+
+func (m *metrics) recordPublished() {
+	m.mu.Lock()
+	m.published++
+	m.mu.Unlock()
+}
+
+func (m *metrics) recordDeduplicated() {
+	m.mu.Lock()
+	m.deduplicated++
+	m.mu.Unlock()
+}
+
+// observeDeltaSize records the size in bytes of a published delta payload.
+func (m *metrics) observeDeltaSize(size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deltaSizeSum += float64(size)
+	m.deltaSizeObs++
+	for _, bound := range deltaSizeBucketBounds {
+		if float64(size) <= bound {
+			m.deltaBuckets[bound]++
+		}
+	}
+}
+
+func (m *metrics) snapshot() metricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buckets := make(map[float64]uint64, len(m.deltaBuckets))
+	for bound, count := range m.deltaBuckets {
+		buckets[bound] = count
+	}
+
+	return metricsSnapshot{
+		Fetched:      m.fetched,
+		Published:    m.published,
+		Deduplicated: m.deduplicated,
+		DeltaBuckets: buckets,
+		DeltaSizeSum: m.deltaSizeSum,
+		DeltaSizeObs: m.deltaSizeObs,
+	}
+}
+
+// registerMetricsHandler wires /metrics, rendering Prometheus text
+// exposition format counters and a histogram for every network's fetch,
+// publish, and dedup activity.
+func registerMetricsHandler(mux *http.ServeMux, runtimes []*networkRuntime) {
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		type namedSnapshot struct {
+			network string
+			metricsSnapshot
+		}
+		snapshots := make([]namedSnapshot, 0, len(runtimes))
+		for _, rt := range runtimes {
+			snapshots = append(snapshots, namedSnapshot{network: rt.config.Name, metricsSnapshot: rt.metrics.snapshot()})
+		}
+
+		fmt.Fprintln(w, "# HELP katpool_templates_fetched_total Block templates fetched from kaspad.")
+		fmt.Fprintln(w, "# TYPE katpool_templates_fetched_total counter")
+		for _, s := range snapshots {
+			fmt.Fprintf(w, "katpool_templates_fetched_total{network=%q} %d\n", s.network, s.Fetched)
+		}
+
+		fmt.Fprintln(w, "# HELP katpool_templates_published_total Block templates published in full because their content changed.")
+		fmt.Fprintln(w, "# TYPE katpool_templates_published_total counter")
+		for _, s := range snapshots {
+			fmt.Fprintf(w, "katpool_templates_published_total{network=%q} %d\n", s.network, s.Published)
+		}
+
+		fmt.Fprintln(w, "# HELP katpool_templates_deduplicated_total Fetched templates skipped because their content hash matched the last published template.")
+		fmt.Fprintln(w, "# TYPE katpool_templates_deduplicated_total counter")
+		for _, s := range snapshots {
+			fmt.Fprintf(w, "katpool_templates_deduplicated_total{network=%q} %d\n", s.network, s.Deduplicated)
+		}
+
+		fmt.Fprintln(w, "# HELP katpool_template_delta_bytes Size in bytes of the compact delta payload published when a template changes.")
+		fmt.Fprintln(w, "# TYPE katpool_template_delta_bytes histogram")
+		for _, s := range snapshots {
+			for _, bound := range deltaSizeBucketBounds {
+				fmt.Fprintf(w, "katpool_template_delta_bytes_bucket{network=%q,le=\"%g\"} %d\n", s.network, bound, s.DeltaBuckets[bound])
+			}
+			fmt.Fprintf(w, "katpool_template_delta_bytes_bucket{network=%q,le=\"+Inf\"} %d\n", s.network, s.DeltaSizeObs)
+			fmt.Fprintf(w, "katpool_template_delta_bytes_sum{network=%q} %g\n", s.network, s.DeltaSizeSum)
+			fmt.Fprintf(w, "katpool_template_delta_bytes_count{network=%q} %d\n", s.network, s.DeltaSizeObs)
+		}
+	})
+}
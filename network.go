@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/kaspanet/kaspad/app/appmessage"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// NetworkConfig describes a single Kaspa network this fetcher templates
+// for: its RPC endpoints, address derivation details, and Redis
+// destination. Running with multiple entries lets one deployment serve
+// several networks (e.g. mainnet and testnet-10) concurrently, each
+// publishing to its own Redis channel or stream.
+type NetworkConfig struct {
+	Name           string   `json:"name"`
+	RPCServer      []string `json:"node"`
+	TreasuryKeyEnv string   `json:"treasury_private_key_env"`
+	CanxiumAddr    string   `json:"canxiumAddr"`
+	MinerInfo      string   `json:"miner_info"`
+
+	RedisChannel       string `json:"redis_channel"`
+	RedisMode          string `json:"redis_mode"`
+	RedisStreamMaxLen  int64  `json:"redis_stream_maxlen"`
+	RedisConsumerGroup string `json:"redis_consumer_group"`
+	RedisConsumerName  string `json:"redis_consumer_name"`
+	RedisClaimIdleMSec string `json:"redis_claim_idle_milliseconds"`
+
+	DAALagThreshold uint64 `json:"daa_lag_threshold"`
+}
+
+// resolveNetworks parses raw, which may be either a single legacy network
+// name (a JSON string, as BridgeConfig.Network used to be) or a list of
+// NetworkConfig entries. It always returns the list form: a legacy string
+// is auto-migrated into a single-entry list built from the rest of
+// config, so existing single-network deployments keep working unchanged.
+func resolveNetworks(raw json.RawMessage, config BridgeConfig) ([]NetworkConfig, error) {
+	var networks []NetworkConfig
+	if err := json.Unmarshal(raw, &networks); err == nil {
+		return networks, nil
+	}
+
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return nil, errors.Errorf(`invalid "network" config: %s`, err)
+	}
+
+	return []NetworkConfig{{
+		Name:               name,
+		RPCServer:          config.RPCServer,
+		TreasuryKeyEnv:     "TREASURY_PRIVATE_KEY",
+		CanxiumAddr:        config.CanxiumAddr,
+		MinerInfo:          config.MinerInfo,
+		RedisChannel:       config.RedisChannel,
+		RedisMode:          config.RedisMode,
+		RedisStreamMaxLen:  config.RedisStreamMaxLen,
+		RedisConsumerGroup: config.RedisConsumerGroup,
+		RedisConsumerName:  config.RedisConsumerName,
+		RedisClaimIdleMSec: config.RedisClaimIdleMSec,
+		DAALagThreshold:    config.DAALagThreshold,
+	}}, nil
+}
+
+// defaultRPCAddrs returns the historical hardcoded node address for a
+// named network, used when a NetworkConfig entry does not list explicit
+// RPC endpoints.
+func defaultRPCAddrs(network string) []string {
+	switch network {
+	case "testnet-10":
+		return []string{"kaspad-test10:16210"}
+	default:
+		return []string{"kaspad:16110"}
+	}
+}
+
+// reloadableConfig holds the subset of a network's settings that
+// /config/reload can swap at runtime without restarting its goroutines.
+type reloadableConfig struct {
+	MinerInfo     string
+	CanxiumAddr   string
+	BlockWaitTime time.Duration
+}
+
+// networkRuntime bundles the running state for a single NetworkConfig: its
+// mining address, Kaspa API pool, last-fetched template, hot-reloadable
+// settings, and (when in stream mode) Redis stream health.
+type networkRuntime struct {
+	config  NetworkConfig
+	address string
+	ksAPI   *KaspaAPI
+
+	mu               sync.Mutex
+	currentTemplate  *appmessage.GetBlockTemplateResponseMessage
+	lastTemplateJSON []byte
+	lastHash         uint64
+	haveLastHash     bool
+
+	rcMu sync.RWMutex
+	rc   reloadableConfig
+
+	streamState *StreamState
+	metrics     *metrics
+
+	subMu       sync.Mutex
+	subscribers map[chan []byte]struct{}
+}
+
+// getReloadableConfig returns the current hot-reloadable settings.
+func (rt *networkRuntime) getReloadableConfig() reloadableConfig {
+	rt.rcMu.RLock()
+	defer rt.rcMu.RUnlock()
+	return rt.rc
+}
+
+// setReloadableConfig atomically swaps the hot-reloadable settings; the
+// next fetch iteration picks them up.
+func (rt *networkRuntime) setReloadableConfig(rc reloadableConfig) {
+	rt.rcMu.Lock()
+	rt.rc = rc
+	rt.rcMu.Unlock()
+}
+
+// subscribe registers a new listener for freshly fetched templates,
+// delivered as serialized JSON. Callers must unsubscribe when done.
+func (rt *networkRuntime) subscribe() chan []byte {
+	ch := make(chan []byte, 1)
+	rt.subMu.Lock()
+	rt.subscribers[ch] = struct{}{}
+	rt.subMu.Unlock()
+	return ch
+}
+
+// unsubscribe removes a listener previously returned by subscribe.
+func (rt *networkRuntime) unsubscribe(ch chan []byte) {
+	rt.subMu.Lock()
+	delete(rt.subscribers, ch)
+	rt.subMu.Unlock()
+}
+
+// broadcast delivers templateJSON to every current subscriber. Slow
+// subscribers are dropped rather than blocking the fetch loop: each
+// channel only ever holds the latest template.
+func (rt *networkRuntime) broadcast(templateJSON []byte) {
+	rt.subMu.Lock()
+	defer rt.subMu.Unlock()
+
+	for ch := range rt.subscribers {
+		select {
+		case ch <- templateJSON:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- templateJSON
+		}
+	}
+}
+
+// newNetworkRuntime derives the mining address, connects the Kaspa RPC
+// pool, and prepares the Redis Streams transport (if selected) for a
+// single network entry.
+func newNetworkRuntime(ctx context.Context, rdb *redis.Client, net NetworkConfig, blockWaitTime time.Duration) (*networkRuntime, error) {
+	privateKey := os.Getenv(net.TreasuryKeyEnv)
+	address, err := fetchKaspaAccountFromPrivateKey(net.Name, privateKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "network %s: failed to retrieve address from private key", net.Name)
+	}
+	log.Printf("network %s: address %s", net.Name, address)
+
+	rpcAddrs := net.RPCServer
+	if len(rpcAddrs) == 0 {
+		rpcAddrs = defaultRPCAddrs(net.Name)
+	}
+
+	ksAPI, err := NewKaspaAPI(rpcAddrs, blockWaitTime, net.DAALagThreshold)
+	if err != nil {
+		return nil, errors.Wrapf(err, "network %s: failed to initialize Kaspa API", net.Name)
+	}
+
+	streamState := &StreamState{}
+	if net.RedisMode == "stream" {
+		if net.RedisConsumerGroup == "" {
+			net.RedisConsumerGroup = net.Name + "-workers"
+		}
+		if net.RedisConsumerName == "" {
+			net.RedisConsumerName = "blocktemplate-fetcher"
+		}
+		if net.RedisStreamMaxLen == 0 {
+			net.RedisStreamMaxLen = 10000
+		}
+
+		if err := ensureConsumerGroup(ctx, rdb, net.RedisChannel, net.RedisConsumerGroup); err != nil {
+			return nil, errors.Wrapf(err, "network %s: failed to create Redis consumer group", net.Name)
+		}
+
+		idleMSec, err := strconv.Atoi(net.RedisClaimIdleMSec)
+		if err != nil || idleMSec <= 0 {
+			idleMSec = 30000
+		}
+		go runStreamPendingWatchLoop(ctx, rdb, net, streamState, time.Duration(idleMSec)*time.Millisecond)
+	}
+
+	return &networkRuntime{
+		config:  net,
+		address: address,
+		ksAPI:   ksAPI,
+		rc: reloadableConfig{
+			MinerInfo:     net.MinerInfo,
+			CanxiumAddr:   net.CanxiumAddr,
+			BlockWaitTime: blockWaitTime,
+		},
+		streamState: streamState,
+		metrics:     newMetrics(),
+		subscribers: make(map[chan []byte]struct{}),
+	}, nil
+}
+
+// changedFieldsMaxDepth bounds how many levels of nested JSON objects
+// changedFields walks into (e.g. "Block" -> "Header" -> "DAAScore" is
+// depth 3), so a subscriber learns which field inside the block actually
+// moved rather than just seeing "Block" on every template.
+const changedFieldsMaxDepth = 3
+
+// changedFields returns the dotted-path JSON keys that differ between
+// prevJSON and newJSON, used to populate a templateDelta's ChangedFields.
+// GetBlockTemplateResponseMessage's only top-level fields are Block,
+// IsSynced, and Error, and Block changes on essentially every new
+// template, so diffing only the top level would report "Block" on almost
+// every delta. Walking into nested objects up to changedFieldsMaxDepth
+// instead surfaces e.g. "Block.Header.DAAScore" or
+// "Block.Header.HashMerkleRoot", without this package needing to know the
+// full shape of appmessage.GetBlockTemplateResponseMessage: any JSON
+// object is walked generically, and arrays (such as Block.Transactions)
+// are compared as opaque values rather than diffed element-by-element.
+func changedFields(prevJSON, newJSON []byte) []string {
+	var changed []string
+	diffJSONValues("", prevJSON, newJSON, 0, &changed)
+	sort.Strings(changed)
+	return changed
+}
+
+// diffJSONValues compares prevVal and newVal and, when they differ and
+// both still unmarshal as JSON objects and depth is below
+// changedFieldsMaxDepth, recurses into their fields instead of recording
+// prefix itself as changed. Fields present in only one side are recorded
+// as changed without recursing, since there is nothing to diff into.
+func diffJSONValues(prefix string, prevVal, newVal json.RawMessage, depth int, changed *[]string) {
+	if bytes.Equal(bytes.TrimSpace(prevVal), bytes.TrimSpace(newVal)) {
+		return
+	}
+
+	if depth < changedFieldsMaxDepth {
+		var prevObj, newObj map[string]json.RawMessage
+		if json.Unmarshal(prevVal, &prevObj) == nil && json.Unmarshal(newVal, &newObj) == nil {
+			for key, nv := range newObj {
+				path := key
+				if prefix != "" {
+					path = prefix + "." + key
+				}
+				if pv, ok := prevObj[key]; ok {
+					diffJSONValues(path, pv, nv, depth+1, changed)
+				} else {
+					*changed = append(*changed, path)
+				}
+			}
+			for key := range prevObj {
+				if _, ok := newObj[key]; !ok {
+					path := key
+					if prefix != "" {
+						path = prefix + "." + key
+					}
+					*changed = append(*changed, path)
+				}
+			}
+			return
+		}
+	}
+
+	if prefix == "" {
+		prefix = "(root)"
+	}
+	*changed = append(*changed, prefix)
+}
+
+// runFetchLoop fetches block templates for a single network and publishes
+// them to that network's configured Redis destination. It runs for the
+// lifetime of the process, one instance per network entry, all sharing the
+// same Redis client. MinerInfo, CanxiumAddr, and the wait interval are
+// re-read from rt's reloadable config on every iteration, so a
+// /config/reload takes effect without restarting this goroutine.
+//
+// Fetches are driven by rt.ksAPI's NotifyNewBlockTemplate push
+// notifications rather than a fixed poll interval: each iteration ends by
+// blocking in WaitForNewTemplate until a notification arrives. BlockWaitTime
+// is passed as that call's max wait, so it now acts as a staleness watchdog
+// that still forces a fetch if notifications are ever missed, rather than
+// the primary cadence.
+//
+// A fetched template whose content hash matches the last one published is
+// not republished in full: only a lightweight heartbeat is sent, and the
+// fetch is counted as deduplicated. When the hash differs, the full
+// template is published as before and a compact delta describing which
+// top-level fields changed is published alongside it.
+func runFetchLoop(ctx context.Context, rdb *redis.Client, rt *networkRuntime) {
+	for {
+		rc := rt.getReloadableConfig()
+
+		template, err := rt.ksAPI.GetBlockTemplate(rt.address, ProcessCanxiumAddress(rc.CanxiumAddr), rc.MinerInfo)
+		if err != nil {
+			log.Printf("network %s: error fetching block template: %v", rt.config.Name, err)
+			rt.ksAPI.WaitForNewTemplate(rc.BlockWaitTime)
+			continue
+		}
+		rt.metrics.recordFetched()
+
+		templateJSON, err := json.Marshal(template)
+		if err != nil {
+			log.Printf("network %s: error serializing template to JSON: %v", rt.config.Name, err)
+			continue
+		}
+		hash := xxhash.Sum64(templateJSON)
+
+		rt.mu.Lock()
+		rt.currentTemplate = template
+		prevHash, prevTemplateJSON, haveLastHash := rt.lastHash, rt.lastTemplateJSON, rt.haveLastHash
+		rt.mu.Unlock()
+
+		if haveLastHash && hash == prevHash {
+			rt.metrics.recordDeduplicated()
+			if err := publishHeartbeat(ctx, rdb, rt.config, hash); err != nil {
+				log.Printf("network %s: error publishing heartbeat: %v", rt.config.Name, err)
+			}
+			rt.ksAPI.WaitForNewTemplate(rc.BlockWaitTime)
+			continue
+		}
+
+		rt.broadcast(templateJSON)
+
+		if err := publishTemplate(ctx, rdb, rt.config, templateJSON, template.Block.Header.DAAScore); err != nil {
+			log.Printf("network %s: error publishing to Redis: %v", rt.config.Name, err)
+		} else {
+			rt.metrics.recordPublished()
+		}
+
+		if haveLastHash {
+			delta := templateDelta{
+				PrevHash:      fmt.Sprintf("%x", prevHash),
+				NewHash:       fmt.Sprintf("%x", hash),
+				ChangedFields: changedFields(prevTemplateJSON, templateJSON),
+			}
+			deltaJSON, err := json.Marshal(delta)
+			if err != nil {
+				log.Printf("network %s: error serializing delta: %v", rt.config.Name, err)
+			} else {
+				rt.metrics.observeDeltaSize(len(deltaJSON))
+				if err := publishDelta(ctx, rdb, rt.config, deltaJSON); err != nil {
+					log.Printf("network %s: error publishing delta: %v", rt.config.Name, err)
+				}
+			}
+		}
+
+		rt.mu.Lock()
+		rt.lastHash = hash
+		rt.lastTemplateJSON = templateJSON
+		rt.haveLastHash = true
+		rt.mu.Unlock()
+
+		rt.ksAPI.WaitForNewTemplate(rc.BlockWaitTime)
+	}
+}
+
+// hasTemplate reports whether this network has fetched at least one
+// block template so far.
+func (rt *networkRuntime) hasTemplate() bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.currentTemplate != nil
+}
+
+// getCurrentTemplate returns the most recently fetched template, or nil if
+// none has been fetched yet.
+func (rt *networkRuntime) getCurrentTemplate() *appmessage.GetBlockTemplateResponseMessage {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.currentTemplate
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangedFieldsIdentical(t *testing.T) {
+	prev := []byte(`{"Block":{"Header":{"DAAScore":1,"Bits":2}},"IsSynced":true}`)
+	next := prev
+	if got := changedFields(prev, next); len(got) != 0 {
+		t.Errorf("changedFields(identical) = %v, want empty", got)
+	}
+}
+
+func TestChangedFieldsNestedField(t *testing.T) {
+	prev := []byte(`{"Block":{"Header":{"DAAScore":1,"Bits":2},"Transactions":[1,2]},"IsSynced":true}`)
+	next := []byte(`{"Block":{"Header":{"DAAScore":2,"Bits":2},"Transactions":[1,2]},"IsSynced":true}`)
+
+	want := []string{"Block.Header.DAAScore"}
+	if got := changedFields(prev, next); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFields() = %v, want %v", got, want)
+	}
+}
+
+func TestChangedFieldsArrayTreatedAsOpaque(t *testing.T) {
+	prev := []byte(`{"Block":{"Header":{"DAAScore":1},"Transactions":[1,2]},"IsSynced":true}`)
+	next := []byte(`{"Block":{"Header":{"DAAScore":1},"Transactions":[1,2,3]},"IsSynced":true}`)
+
+	want := []string{"Block.Transactions"}
+	if got := changedFields(prev, next); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFields() = %v, want %v", got, want)
+	}
+}
+
+func TestChangedFieldsTopLevelAddedField(t *testing.T) {
+	prev := []byte(`{"Block":{"Header":{"DAAScore":1}}}`)
+	next := []byte(`{"Block":{"Header":{"DAAScore":1}},"Error":{"Message":"synced"}}`)
+
+	want := []string{"Error"}
+	if got := changedFields(prev, next); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFields() = %v, want %v", got, want)
+	}
+}
+
+func TestChangedFieldsRespectsMaxDepth(t *testing.T) {
+	// "Block.Header.Parents.Hashes" is 4 levels deep, past
+	// changedFieldsMaxDepth (3), so the differing leaf should be reported
+	// at the depth-3 boundary ("Block.Header.Parents") rather than walked
+	// all the way down.
+	prev := []byte(`{"Block":{"Header":{"Parents":{"Hashes":["a"]}}}}`)
+	next := []byte(`{"Block":{"Header":{"Parents":{"Hashes":["a","b"]}}}}`)
+
+	want := []string{"Block.Header.Parents"}
+	if got := changedFields(prev, next); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFields() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// templateDelta is the compact payload published on a network's ".deltas"
+// destination when a newly fetched template differs from the last one
+// published, so subscribers already holding the previous template can
+// update without re-parsing the full payload.
+type templateDelta struct {
+	PrevHash      string   `json:"prev_hash"`
+	NewHash       string   `json:"new_hash"`
+	ChangedFields []string `json:"changed_fields"`
+}
+
+// StreamState tracks Redis Streams transport health, in particular the
+// number of entries that have been delivered to a consumer but not yet
+// acknowledged, as last observed by the XAUTOCLAIM rebalance loop. It is
+// read by the /health handler and written by runStreamPendingWatchLoop.
+type StreamState struct {
+	mu      sync.Mutex
+	pending int64
+}
+
+func (s *StreamState) set(pending int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = pending
+}
+
+func (s *StreamState) get() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// ensureConsumerGroup creates the consumer group for stream if it does not
+// already exist, creating the stream itself as needed. It is safe to call
+// on every startup.
+func ensureConsumerGroup(ctx context.Context, rdb *redis.Client, stream, group string) error {
+	err := rdb.XGroupCreateMkStream(ctx, stream, group, "$").Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// publishTemplate writes the serialized template to Redis using the
+// transport selected by config.RedisMode. In "stream" mode it appends the
+// entry with XADD, trimming the stream to roughly RedisStreamMaxLen entries
+// so that memory use stays bounded while still giving late-joining
+// consumers a window to resume from the last acknowledged ID. In "pubsub"
+// mode (the default, preserved for backward compatibility) it keeps the
+// original fire-and-forget Publish behavior.
+func publishTemplate(ctx context.Context, rdb *redis.Client, net NetworkConfig, templateJSON []byte, daaScore uint64) error {
+	if net.RedisMode == "stream" {
+		id, err := rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: net.RedisChannel,
+			MaxLen: net.RedisStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{
+				"template":  templateJSON,
+				"daa_score": daaScore,
+				"timestamp": time.Now().UnixMilli(),
+			},
+		}).Result()
+		if err != nil {
+			return err
+		}
+		log.Printf("network %s: template appended to Redis stream %s as %s", net.Name, net.RedisChannel, id)
+		return nil
+	}
+
+	if err := rdb.Publish(ctx, net.RedisChannel, templateJSON).Err(); err != nil {
+		return err
+	}
+	log.Printf("network %s: template published to Redis channel %s", net.Name, net.RedisChannel)
+	return nil
+}
+
+// publishDelta writes an already-serialized templateDelta to the network's
+// ".deltas" destination, using the same transport (pubsub channel or
+// stream) as publishTemplate.
+func publishDelta(ctx context.Context, rdb *redis.Client, net NetworkConfig, deltaJSON []byte) error {
+	channel := net.RedisChannel + ".deltas"
+	if net.RedisMode == "stream" {
+		return rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: channel,
+			MaxLen: net.RedisStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{
+				"delta":     deltaJSON,
+				"timestamp": time.Now().UnixMilli(),
+			},
+		}).Err()
+	}
+	return rdb.Publish(ctx, channel, deltaJSON).Err()
+}
+
+// publishHeartbeat writes a lightweight marker to the network's
+// ".heartbeat" channel when a fetched template is identical to the last
+// one published, so downstream consumers can tell the fetcher is alive
+// without re-delivering the full payload.
+func publishHeartbeat(ctx context.Context, rdb *redis.Client, net NetworkConfig, hash uint64) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"network":   net.Name,
+		"hash":      fmt.Sprintf("%x", hash),
+		"timestamp": time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return err
+	}
+	return rdb.Publish(ctx, net.RedisChannel+".heartbeat", payload).Err()
+}
+
+// runStreamPendingWatchLoop periodically records the consumer group's
+// pending-entry count on state so it can be reported through /health.
+//
+// This process is a producer, not a stream consumer: it never calls
+// XReadGroup/XAck, so it has no entries of its own to reclaim, and
+// RedisConsumerName identifies it rather than any of the actual worker
+// processes reading the stream. An earlier version of this loop ran
+// XAUTOCLAIM here, which reassigned other workers' crashed/stalled pending
+// entries to this process's own consumer identity - which then never read
+// or acked them either, silently orphaning those entries and taking them
+// away from the workers that could have recovered them. Reclaiming stuck
+// entries is a job for the consumer-side workers themselves; this loop
+// only observes and reports.
+func runStreamPendingWatchLoop(ctx context.Context, rdb *redis.Client, net NetworkConfig, state *StreamState, idle time.Duration) {
+	ticker := time.NewTicker(idle)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pending, err := rdb.XPending(ctx, net.RedisChannel, net.RedisConsumerGroup).Result()
+		if err != nil {
+			log.Printf("network %s: error checking stream pending count for %s: %v", net.Name, net.RedisChannel, err)
+			continue
+		}
+		state.set(pending.Count)
+	}
+}